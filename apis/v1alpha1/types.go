@@ -0,0 +1,150 @@
+// Package v1alpha1 contains the RabbitMQAutoscaler custom resource definition.
+//
+// There is no generated clientset or deepcopy in this tree: the controller
+// talks to the apiserver through the dynamic client and converts between
+// unstructured.Unstructured and these types with
+// runtime.DefaultUnstructuredConverter. Keep the struct tags in sync with the
+// CRD's OpenAPI schema (deploy/crds/rabbitmq.basset.io_rabbitmqautoscalers.yaml).
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GroupName is the API group the RabbitMQAutoscaler CRD is registered under.
+const GroupName = "rabbitmq.basset.io"
+
+// Version is the API version served for the RabbitMQAutoscaler CRD.
+const Version = "v1alpha1"
+
+// Resource is the plural resource name used in the CRD's GroupVersionResource.
+const Resource = "rabbitmqautoscalers"
+
+// GroupVersion is the GroupVersion handled by this package.
+var GroupVersion = schema.GroupVersion{Group: GroupName, Version: Version}
+
+// GroupVersionResource is the GVR used to talk to the apiserver via the
+// dynamic client and dynamic informer factory.
+var GroupVersionResource = GroupVersion.WithResource(Resource)
+
+// AggregationMode controls how message counts across multiple QueueTargets
+// are combined into a single backlog figure before computing replicas.
+type AggregationMode string
+
+const (
+	// AggregationSum adds the (weighted) message count of every queue target.
+	AggregationSum AggregationMode = "sum"
+	// AggregationMax uses the largest (weighted) message count across queue targets.
+	AggregationMax AggregationMode = "max"
+	// AggregationAvg averages the (weighted) message count across queue targets.
+	AggregationAvg AggregationMode = "avg"
+)
+
+// QueueTarget names a single RabbitMQ queue this autoscaler should watch.
+type QueueTarget struct {
+	// Name is the queue name as declared in RabbitMQ.
+	Name string `json:"name"`
+	// VHost is the RabbitMQ virtual host the queue lives in. Defaults to "/".
+	// Only the management API path uses it; over AMQP the queue is inspected
+	// on the virtual host of the connected broker URI, whatever VHost says.
+	VHost string `json:"vhost,omitempty"`
+	// Weight scales this queue's contribution before aggregation. Defaults to 1.
+	Weight int32 `json:"weight,omitempty"`
+	// MsgPerPod is the number of backlog messages one pod is expected to
+	// drain, used by ScalingModeCount. Under ScalingModeRate this field is
+	// reinterpreted as a per-second publish-rate throughput (messages/sec)
+	// one pod can absorb, rather than a message count - see
+	// scaling.DesiredRate.
+	MsgPerPod int32 `json:"msgPerPod"`
+}
+
+// ScaleTargetRef identifies the workload to resize. Any resource exposing the
+// scale subresource (Deployment, StatefulSet, ReplicaSet, ...) is supported.
+type ScaleTargetRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+}
+
+// ScalingMode selects the algorithm used to turn queue observations into a
+// replica count.
+type ScalingMode string
+
+const (
+	// ScalingModeCount is ceil(messages / MsgPerPod), the original heuristic.
+	ScalingModeCount ScalingMode = "count"
+	// ScalingModeRate sizes the fleet off the RabbitMQ management API's
+	// publish/consume rate derivatives instead of the raw backlog. It
+	// ignores queue depth entirely: if producers quiesce while a large
+	// backlog remains queued, the observed rate drops to zero and this mode
+	// clamps to MinReplicas and strands that backlog. Use
+	// ScalingModeDrainSLA instead when the backlog itself, not just its
+	// rate of change, should keep the fleet scaled up.
+	ScalingModeRate ScalingMode = "rate"
+	// ScalingModeDrainSLA picks the smallest replica count that keeps
+	// estimated time-to-drain under DrainSLASeconds.
+	ScalingModeDrainSLA ScalingMode = "drain-sla"
+)
+
+// RabbitMQAutoscalerSpec is the desired state of a RabbitMQAutoscaler.
+type RabbitMQAutoscalerSpec struct {
+	ScaleTargetRef ScaleTargetRef `json:"scaleTargetRef"`
+	QueueTargets   []QueueTarget  `json:"queueTargets"`
+	// Aggregation combines the queue targets' message counts. Defaults to AggregationSum.
+	Aggregation AggregationMode `json:"aggregation,omitempty"`
+	MinReplicas int32           `json:"minReplicas"`
+	MaxReplicas int32           `json:"maxReplicas"`
+	// ScaleDownFactor dampens scale-down decisions the same way the legacy
+	// single-deployment autoscaler's SCALE_FACTOR env var did: this fraction
+	// of the possible reduction is held back per reconcile. Defaults to 0
+	// (the full reduction is applied immediately).
+	ScaleDownFactor float64 `json:"scaleDownFactor,omitempty"`
+	// ScaleUpFactor is ScaleDownFactor's counterpart for scale-up decisions:
+	// this fraction of the possible increase is held back per reconcile.
+	// Defaults to 0 (no damping - the full increase is applied immediately),
+	// since under-provisioning during a backlog spike is usually worse than
+	// the thrashing ScaleDownFactor guards against.
+	ScaleUpFactor float64 `json:"scaleUpFactor,omitempty"`
+
+	// ScalingMode selects the replica calculation. Defaults to ScalingModeCount,
+	// which requires no RabbitMQ management API access.
+	ScalingMode ScalingMode `json:"scalingMode,omitempty"`
+	// DrainSLASeconds is the target time-to-drain used by ScalingModeDrainSLA.
+	DrainSLASeconds int32 `json:"drainSLASeconds,omitempty"`
+
+	// ScaleUpStabilizationSeconds, if set, suppresses a scale-up decision
+	// until this many seconds have passed since the last scale event,
+	// mirroring HPA v2's behavior.stabilizationWindowSeconds.
+	ScaleUpStabilizationSeconds int32 `json:"scaleUpStabilizationSeconds,omitempty"`
+	// ScaleDownStabilizationSeconds is the equivalent cooldown for scale-down decisions.
+	ScaleDownStabilizationSeconds int32 `json:"scaleDownStabilizationSeconds,omitempty"`
+}
+
+// RabbitMQAutoscalerStatus is the observed state of a RabbitMQAutoscaler,
+// written back by the controller after each reconcile that resizes the
+// scale target; reconciles that leave the replica count unchanged do not
+// update it.
+type RabbitMQAutoscalerStatus struct {
+	ObservedMessages int64        `json:"observedMessages,omitempty"`
+	CurrentReplicas  int32        `json:"currentReplicas,omitempty"`
+	DesiredReplicas  int32        `json:"desiredReplicas,omitempty"`
+	LastScaleTime    *metav1.Time `json:"lastScaleTime,omitempty"`
+}
+
+// RabbitMQAutoscaler is the schema for the rabbitmqautoscalers API.
+type RabbitMQAutoscaler struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RabbitMQAutoscalerSpec   `json:"spec"`
+	Status RabbitMQAutoscalerStatus `json:"status,omitempty"`
+}
+
+// RabbitMQAutoscalerList is a list of RabbitMQAutoscaler resources.
+type RabbitMQAutoscalerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []RabbitMQAutoscaler `json:"items"`
+}
@@ -0,0 +1,390 @@
+// Package controller reconciles RabbitMQAutoscaler resources.
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/scale"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/basset/rabbitmq-pod-autoscaler/apis/v1alpha1"
+	"github.com/basset/rabbitmq-pod-autoscaler/internal/metrics"
+	"github.com/basset/rabbitmq-pod-autoscaler/internal/rabbitmq"
+	"github.com/basset/rabbitmq-pod-autoscaler/internal/scaling"
+)
+
+// Controller watches RabbitMQAutoscaler resources and resizes their scale
+// target to match observed RabbitMQ backlog.
+type Controller struct {
+	informer      cache.SharedIndexInformer
+	dynamicClient dynamic.Interface
+	scaleClient   scale.ScalesGetter
+	restMapper    meta.RESTMapper
+	rmq           *rabbitmq.Client
+	mgmt          *rabbitmq.ManagementClient
+
+	workqueue workqueue.RateLimitingInterface
+
+	// rateWindows holds one *scaling.RateWindow per (namespace, autoscaler,
+	// queue), keyed by rateWindowKey, so ScalingModeRate and
+	// ScalingModeDrainSLA smooth over a trailing window of management-API
+	// samples instead of reacting to a single reconcile's reading.
+	rateWindows sync.Map
+}
+
+// New builds a Controller. informer must already be registered for
+// v1alpha1.GroupVersionResource. mgmt may be nil if no autoscaler in the
+// cluster uses ScalingModeRate or ScalingModeDrainSLA.
+func New(informer cache.SharedIndexInformer, dynamicClient dynamic.Interface, scaleClient scale.ScalesGetter, restMapper meta.RESTMapper, rmq *rabbitmq.Client, mgmt *rabbitmq.ManagementClient) *Controller {
+	c := &Controller{
+		informer:      informer,
+		dynamicClient: dynamicClient,
+		scaleClient:   scaleClient,
+		restMapper:    restMapper,
+		rmq:           rmq,
+		mgmt:          mgmt,
+		workqueue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "rabbitmqautoscalers"),
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(old, new interface{}) {
+			c.enqueue(new)
+		},
+		DeleteFunc: c.forgetRateWindows,
+	})
+
+	return c
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Errorf("[Controller] Error computing key: %s", err)
+		return
+	}
+	c.workqueue.Add(key)
+}
+
+// HasSynced reports whether the underlying informer's cache has synced, so
+// callers (the /readyz handler) can gate on it.
+func (c *Controller) HasSynced() bool {
+	return c.informer.HasSynced()
+}
+
+// Run starts workers reconciling off the shared informer's cache until
+// stopCh is closed. It blocks until stopCh is closed, then shuts down the
+// workqueue; it does not wait for in-flight workers to finish.
+func (c *Controller) Run(workers int, stopCh <-chan struct{}) error {
+	defer c.workqueue.ShutDown()
+
+	klog.Info("[Controller] Waiting for informer cache to sync")
+	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+		return fmt.Errorf("timed out waiting for informer cache to sync")
+	}
+
+	klog.Infof("[Controller] Starting %d workers", workers)
+	for i := 0; i < workers; i++ {
+		go c.runWorker(stopCh)
+	}
+
+	<-stopCh
+	return nil
+}
+
+func (c *Controller) runWorker(stopCh <-chan struct{}) {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *Controller) processNextWorkItem() bool {
+	key, shutdown := c.workqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.workqueue.Done(key)
+
+	if err := c.syncHandler(key.(string)); err != nil {
+		c.workqueue.AddRateLimited(key)
+		klog.Errorf("[Controller] Error syncing %q, requeuing: %s", key, err)
+		return true
+	}
+
+	c.workqueue.Forget(key)
+	return true
+}
+
+func (c *Controller) syncHandler(key string) (err error) {
+	start := time.Now()
+	namespace, name, splitErr := cache.SplitMetaNamespaceKey(key)
+	if splitErr != nil {
+		return fmt.Errorf("splitting key %q: %w", key, splitErr)
+	}
+	defer func() {
+		metrics.ReconcileDuration.WithLabelValues(namespace, name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.ReconcileErrorsTotal.WithLabelValues(namespace, name).Inc()
+		}
+	}()
+
+	obj, exists, err := c.informer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("fetching %q from cache: %w", key, err)
+	}
+	if !exists {
+		// The autoscaler was deleted; nothing to reconcile.
+		return nil
+	}
+
+	var autoscaler v1alpha1.RabbitMQAutoscaler
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.(*unstructured.Unstructured).Object, &autoscaler); err != nil {
+		return fmt.Errorf("decoding %q: %w", key, err)
+	}
+
+	gvr, err := c.scaleTargetGVR(autoscaler.Spec.ScaleTargetRef)
+	if err != nil {
+		return fmt.Errorf("resolving scale target for %q: %w", key, err)
+	}
+
+	currentScale, err := c.scaleClient.Scales(autoscaler.Namespace).Get(context.TODO(), gvr.GroupResource(), autoscaler.Spec.ScaleTargetRef.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("getting scale for %q: %w", key, err)
+	}
+	metrics.CurrentReplicas.WithLabelValues(namespace, name).Set(float64(currentScale.Spec.Replicas))
+
+	backlog, desired, err := c.computeDesired(autoscaler, currentScale.Spec.Replicas, namespace, name)
+	if err != nil {
+		return fmt.Errorf("computing desired replicas for %q: %w", key, err)
+	}
+	metrics.DesiredReplicas.WithLabelValues(namespace, name).Set(float64(desired))
+
+	if desired != currentScale.Spec.Replicas {
+		scalingUp := desired > currentScale.Spec.Replicas
+		if !scaling.CooldownElapsed(statusLastScaleTime(autoscaler), time.Now(), scalingUp, autoscaler.Spec.ScaleUpStabilizationSeconds, autoscaler.Spec.ScaleDownStabilizationSeconds) {
+			klog.V(4).Infof("[Controller] %s: desired %d differs from current %d but still in stabilization window", key, desired, currentScale.Spec.Replicas)
+			return nil
+		}
+
+		updated := currentScale.DeepCopy()
+		updated.Spec.Replicas = desired
+		if _, err := c.scaleClient.Scales(autoscaler.Namespace).Update(context.TODO(), gvr.GroupResource(), updated, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("updating scale for %q: %w", key, err)
+		}
+
+		direction := "up"
+		if !scalingUp {
+			direction = "down"
+		}
+		metrics.ScaleEventsTotal.WithLabelValues(namespace, name, direction).Inc()
+		klog.Infof("[Controller] %s: scaled %s from %d to %d replicas (observed backlog %.0f)", key, autoscaler.Spec.ScaleTargetRef.Name, currentScale.Spec.Replicas, desired, backlog)
+
+		if err := c.updateStatus(obj.(*unstructured.Unstructured), autoscaler.Namespace, int64(backlog), currentScale.Spec.Replicas, desired); err != nil {
+			klog.Errorf("[Controller] %s: failed to update status: %s", key, err)
+		}
+	}
+
+	return nil
+}
+
+// statusLastScaleTime extracts the last recorded scale time as a plain
+// time.Time, or nil if the autoscaler has never been scaled.
+func statusLastScaleTime(autoscaler v1alpha1.RabbitMQAutoscaler) *time.Time {
+	if autoscaler.Status.LastScaleTime == nil {
+		return nil
+	}
+	t := autoscaler.Status.LastScaleTime.Time
+	return &t
+}
+
+// computeDesired observes RabbitMQ and returns the aggregated backlog figure
+// (for logging/status) and the replica count dictated by spec.ScalingMode.
+// ScalingModeRate and ScalingModeDrainSLA feed each queue's management-API
+// rate sample through a per-queue scaling.RateWindow (rateWindowFor) before
+// aggregating, so a single noisy tick can't flap the replica count.
+func (c *Controller) computeDesired(autoscaler v1alpha1.RabbitMQAutoscaler, currentReplicas int32, namespace, name string) (float64, int32, error) {
+	spec := autoscaler.Spec
+
+	switch spec.ScalingMode {
+	case v1alpha1.ScalingModeRate:
+		stats, err := c.observeManagement(spec.QueueTargets)
+		if err != nil {
+			return 0, 0, err
+		}
+		rates := make(map[string]float64, len(stats))
+		now := time.Now()
+		for queue, s := range stats {
+			rates[queue] = c.rateWindowFor(rateWindowKey(namespace, name, queue)).Observe(now, s.PublishRate)
+			metrics.QueueMessages.WithLabelValues(namespace, name, queue).Set(float64(s.Messages))
+			metrics.QueueMessagesReady.WithLabelValues(namespace, name, queue).Set(float64(s.MessagesReady))
+			metrics.QueueMessagesUnacked.WithLabelValues(namespace, name, queue).Set(float64(s.MessagesUnacknowledged))
+		}
+		publishRate, err := scaling.AggregateFloat(spec.Aggregation, spec.QueueTargets, rates)
+		if err != nil {
+			return 0, 0, err
+		}
+		msgPerPod := scaling.AverageMsgPerPod(spec.QueueTargets)
+		return publishRate, scaling.DesiredRate(publishRate, msgPerPod, currentReplicas, spec.MinReplicas, spec.MaxReplicas, spec.ScaleDownFactor, spec.ScaleUpFactor), nil
+
+	case v1alpha1.ScalingModeDrainSLA:
+		stats, err := c.observeManagement(spec.QueueTargets)
+		if err != nil {
+			return 0, 0, err
+		}
+		counts := make(map[string]int64, len(stats))
+		rates := make(map[string]float64, len(stats))
+		now := time.Now()
+		for queue, s := range stats {
+			counts[queue] = s.Messages
+			rates[queue] = c.rateWindowFor(rateWindowKey(namespace, name, queue)).Observe(now, s.DeliverGetRate)
+			metrics.QueueMessages.WithLabelValues(namespace, name, queue).Set(float64(s.Messages))
+			metrics.QueueMessagesReady.WithLabelValues(namespace, name, queue).Set(float64(s.MessagesReady))
+			metrics.QueueMessagesUnacked.WithLabelValues(namespace, name, queue).Set(float64(s.MessagesUnacknowledged))
+		}
+		backlog, err := scaling.Aggregate(spec.Aggregation, spec.QueueTargets, counts)
+		if err != nil {
+			return 0, 0, err
+		}
+		consumeRate, err := scaling.AggregateFloat(spec.Aggregation, spec.QueueTargets, rates)
+		if err != nil {
+			return 0, 0, err
+		}
+		return backlog, scaling.DesiredDrainSLA(backlog, consumeRate, currentReplicas, spec.MinReplicas, spec.MaxReplicas, spec.DrainSLASeconds, spec.ScaleDownFactor, spec.ScaleUpFactor), nil
+
+	default:
+		counts, err := c.observeBacklog(spec.QueueTargets)
+		if err != nil {
+			return 0, 0, err
+		}
+		for queue, count := range counts {
+			metrics.QueueMessages.WithLabelValues(namespace, name, queue).Set(float64(count))
+			// AMQP's QueueInspect only ever reports messages not awaiting
+			// acknowledgment, i.e. exactly the ready count; unacked isn't
+			// observable without the management API.
+			metrics.QueueMessagesReady.WithLabelValues(namespace, name, queue).Set(float64(count))
+		}
+		backlog, err := scaling.Aggregate(spec.Aggregation, spec.QueueTargets, counts)
+		if err != nil {
+			return 0, 0, err
+		}
+		msgPerPod := scaling.AverageMsgPerPod(spec.QueueTargets)
+		return backlog, scaling.Desired(backlog, msgPerPod, currentReplicas, spec.MinReplicas, spec.MaxReplicas, spec.ScaleDownFactor, spec.ScaleUpFactor), nil
+	}
+}
+
+// rateWindowFor returns the RateWindow tracking key, creating one on first
+// use.
+func (c *Controller) rateWindowFor(key string) *scaling.RateWindow {
+	actual, _ := c.rateWindows.LoadOrStore(key, scaling.NewRateWindow(scaling.RateWindowSeconds*time.Second))
+	return actual.(*scaling.RateWindow)
+}
+
+// rateWindowKey identifies a single queue's rate history within a single
+// RabbitMQAutoscaler.
+func rateWindowKey(namespace, name, queue string) string {
+	return namespace + "/" + name + "/" + queue
+}
+
+// forgetRateWindows drops every RateWindow tracked for a deleted
+// RabbitMQAutoscaler. Without this, rateWindows would grow without bound:
+// syncHandler exits early once the informer's cache no longer has the key
+// (see the !exists check above), so it never gets a chance to prune the
+// keys a deleted or renamed autoscaler left behind.
+func (c *Controller) forgetRateWindows(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Errorf("[Controller] Error computing key for deleted object: %s", err)
+		return
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		klog.Errorf("[Controller] Error splitting key %q: %s", key, err)
+		return
+	}
+
+	prefix := rateWindowKey(namespace, name, "")
+	c.rateWindows.Range(func(k, _ interface{}) bool {
+		if strings.HasPrefix(k.(string), prefix) {
+			c.rateWindows.Delete(k)
+		}
+		return true
+	})
+}
+
+// observeBacklog inspects every queue target over AMQP and returns its
+// message count, keyed by queue name.
+func (c *Controller) observeBacklog(targets []v1alpha1.QueueTarget) (map[string]int64, error) {
+	counts := make(map[string]int64, len(targets))
+	for _, t := range targets {
+		count, err := c.rmq.QueueMessageCount(t.VHost, t.Name)
+		if err != nil {
+			return nil, err
+		}
+		counts[t.Name] = count
+	}
+	return counts, nil
+}
+
+// observeManagement inspects every queue target via the RabbitMQ HTTP
+// management API, keyed by queue name.
+func (c *Controller) observeManagement(targets []v1alpha1.QueueTarget) (map[string]rabbitmq.QueueStats, error) {
+	if c.mgmt == nil {
+		return nil, fmt.Errorf("no RabbitMQ management API client configured")
+	}
+	stats := make(map[string]rabbitmq.QueueStats, len(targets))
+	for _, t := range targets {
+		s, err := c.mgmt.QueueStats(t.VHost, t.Name)
+		if err != nil {
+			return nil, err
+		}
+		stats[t.Name] = s
+	}
+	return stats, nil
+}
+
+// updateStatus replaces the autoscaler's status subresource (UpdateStatus)
+// with the latest
+// observation, so CooldownElapsed has a LastScaleTime to read on the next
+// reconcile.
+func (c *Controller) updateStatus(obj *unstructured.Unstructured, namespace string, observedMessages int64, currentReplicas, desiredReplicas int32) error {
+	updated := obj.DeepCopy()
+	status := map[string]interface{}{
+		"observedMessages": observedMessages,
+		"currentReplicas":  int64(currentReplicas),
+		"desiredReplicas":  int64(desiredReplicas),
+		"lastScaleTime":    metav1.Now().Format(time.RFC3339),
+	}
+	if err := unstructured.SetNestedMap(updated.Object, status, "status"); err != nil {
+		return fmt.Errorf("setting status fields: %w", err)
+	}
+
+	_, err := c.dynamicClient.Resource(v1alpha1.GroupVersionResource).Namespace(namespace).UpdateStatus(context.TODO(), updated, metav1.UpdateOptions{})
+	return err
+}
+
+// scaleTargetGVR maps a ScaleTargetRef's apiVersion/kind to the
+// GroupVersionResource the scale client needs to address it.
+func (c *Controller) scaleTargetGVR(ref v1alpha1.ScaleTargetRef) (schema.GroupVersionResource, error) {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return schema.GroupVersionResource{}, fmt.Errorf("parsing apiVersion %q: %w", ref.APIVersion, err)
+	}
+
+	mapping, err := c.restMapper.RESTMapping(gv.WithKind(ref.Kind).GroupKind(), gv.Version)
+	if err != nil {
+		return schema.GroupVersionResource{}, fmt.Errorf("no REST mapping for %s/%s: %w", ref.APIVersion, ref.Kind, err)
+	}
+
+	return mapping.Resource, nil
+}
@@ -0,0 +1,75 @@
+// Package metrics registers the autoscaler's Prometheus collectors.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "rabbitmq_pod_autoscaler"
+
+var (
+	// QueueMessages reports the last observed backlog for a given autoscaler/queue pair.
+	QueueMessages = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_messages",
+		Help:      "Last observed message count for a queue target.",
+	}, []string{"namespace", "autoscaler", "queue"})
+
+	// QueueMessagesReady reports the last observed ready (deliverable) message
+	// count for a queue target. Under ScalingModeCount this is the same
+	// figure as QueueMessages, since AMQP's QueueInspect only ever reports
+	// messages not awaiting acknowledgment.
+	QueueMessagesReady = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_messages_ready",
+		Help:      "Last observed ready message count for a queue target.",
+	}, []string{"namespace", "autoscaler", "queue"})
+
+	// QueueMessagesUnacked reports the last observed unacknowledged message
+	// count for a queue target. Only populated when the management API is
+	// in use (ScalingModeRate, ScalingModeDrainSLA); AMQP's QueueInspect has
+	// no way to report it.
+	QueueMessagesUnacked = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_messages_unacknowledged",
+		Help:      "Last observed unacknowledged message count for a queue target.",
+	}, []string{"namespace", "autoscaler", "queue"})
+
+	// DesiredReplicas is the replica count the controller computed on the last reconcile.
+	DesiredReplicas = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "desired_replicas",
+		Help:      "Desired replica count computed on the last reconcile.",
+	}, []string{"namespace", "autoscaler"})
+
+	// CurrentReplicas is the replica count read back from the scale subresource.
+	CurrentReplicas = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "current_replicas",
+		Help:      "Replica count of the scale target before any update.",
+	}, []string{"namespace", "autoscaler"})
+
+	// ScaleEventsTotal counts every UpdateScale call that succeeded; failed
+	// calls are not counted.
+	ScaleEventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scale_events_total",
+		Help:      "Number of times the controller resized a scale target.",
+	}, []string{"namespace", "autoscaler", "direction"})
+
+	// ReconcileErrorsTotal counts failed syncHandler invocations.
+	ReconcileErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_errors_total",
+		Help:      "Number of reconciles that returned an error.",
+	}, []string{"namespace", "autoscaler"})
+
+	// ReconcileDuration measures how long a single syncHandler call took.
+	ReconcileDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Time spent reconciling a single RabbitMQAutoscaler.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"namespace", "autoscaler"})
+)
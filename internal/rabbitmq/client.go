@@ -0,0 +1,197 @@
+// Package rabbitmq provides the autoscaler's connection to the broker.
+package rabbitmq
+
+import (
+	"crypto/tls"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+	"k8s.io/klog/v2"
+)
+
+// reconnect backoff bounds. Actual delay is randomized within [0, cap) on
+// each attempt (full jitter), doubling cap up to maxBackoff.
+const (
+	minBackoff = 1 * time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// Options configures a Client.
+type Options struct {
+	// URIs is tried in order on initial connect and on every reconnect, so a
+	// single Client can fail over across a cluster of independent brokers.
+	URIs []string
+	// TLSConfig is used for amqps:// URIs. Leave nil to use amqp://.
+	TLSConfig *tls.Config
+	// Management, if set, is used instead of AMQP's QueueInspect to read
+	// queue depth - useful when a queue was declared with arguments the
+	// autoscaler doesn't know and can't safely passive-declare.
+	Management *ManagementClient
+}
+
+// Client is a resilient connection to a RabbitMQ cluster. It reconnects
+// transparently on connection loss with exponential backoff and jitter, and
+// fails over across every URI in Options.URIs.
+type Client struct {
+	uris      []string
+	tlsConfig *tls.Config
+	mgmt      *ManagementClient
+
+	mu     sync.Mutex
+	conn   *amqp.Connection
+	ch     *amqp.Channel
+	closed chan struct{}
+}
+
+// New dials the first reachable broker in opts.URIs and starts a background
+// goroutine that reconnects on connection loss.
+func New(opts Options) (*Client, error) {
+	if len(opts.URIs) == 0 {
+		return nil, fmt.Errorf("no broker URIs configured")
+	}
+
+	c := &Client{
+		uris:      opts.URIs,
+		tlsConfig: opts.TLSConfig,
+		mgmt:      opts.Management,
+		closed:    make(chan struct{}),
+	}
+
+	conn, ch, err := c.dialAny()
+	if err != nil {
+		return nil, err
+	}
+	c.conn, c.ch = conn, ch
+
+	go c.watch()
+
+	return c, nil
+}
+
+// dialAny tries every configured URI in order and returns the first
+// successful connection and channel.
+func (c *Client) dialAny() (*amqp.Connection, *amqp.Channel, error) {
+	var errs []string
+	for _, uri := range c.uris {
+		conn, err := amqp.DialTLS(uri, c.tlsConfig)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", redactURI(uri), err))
+			continue
+		}
+
+		ch, err := conn.Channel()
+		if err != nil {
+			conn.Close()
+			errs = append(errs, fmt.Sprintf("%s: open channel: %s", redactURI(uri), err))
+			continue
+		}
+
+		return conn, ch, nil
+	}
+
+	return nil, nil, fmt.Errorf("failed to dial any broker: %s", strings.Join(errs, "; "))
+}
+
+// watch reconnects with exponential backoff and jitter whenever the active
+// connection closes, until the Client is closed.
+func (c *Client) watch() {
+	for {
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+
+		notifyClose := conn.NotifyClose(make(chan *amqp.Error, 1))
+		select {
+		case err := <-notifyClose:
+			klog.Errorf("[RabbitMQ] Connection closed: %s; reconnecting", err)
+		case <-c.closed:
+			return
+		}
+
+		backoff := minBackoff
+		for {
+			conn, ch, err := c.dialAny()
+			if err == nil {
+				c.mu.Lock()
+				c.conn, c.ch = conn, ch
+				c.mu.Unlock()
+				klog.Info("[RabbitMQ] Reconnected")
+				break
+			}
+
+			klog.Errorf("[RabbitMQ] Reconnect failed: %s; retrying in up to %s", err, backoff)
+			select {
+			case <-time.After(time.Duration(rand.Int63n(int64(backoff)))):
+			case <-c.closed:
+				return
+			}
+			if backoff < maxBackoff {
+				backoff *= 2
+				if backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+			}
+		}
+	}
+}
+
+// QueueMessageCount returns the number of messages currently sitting in
+// name. If Options.Management was set, it is used in preference to AMQP's
+// QueueInspect. vhost is only used by the management path; the AMQP path
+// inspects name on the virtual host of the current connection.
+//
+// The AMQP path holds c.mu across the QueueInspect RPC: streadway/amqp
+// channels correlate replies positionally on a single internal channel, so
+// two goroutines issuing synchronous RPCs on the same *amqp.Channel can
+// receive each other's response. The controller reconciles many
+// RabbitMQAutoscalers concurrently (ctrl.Run(workers, ...)), so this method
+// is on that hot path and must serialize the RPC rather than just the
+// pointer read.
+func (c *Client) QueueMessageCount(vhost, name string) (int64, error) {
+	if c.mgmt != nil {
+		stats, err := c.mgmt.QueueStats(vhost, name)
+		if err != nil {
+			return 0, err
+		}
+		return stats.Messages, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	queue, err := c.ch.QueueInspect(name)
+	if err != nil {
+		return 0, fmt.Errorf("inspect queue %q: %w", name, err)
+	}
+	return int64(queue.Messages), nil
+}
+
+// Close stops the reconnect goroutine and tears down the active connection.
+func (c *Client) Close() error {
+	close(c.closed)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ch != nil {
+		c.ch.Close()
+	}
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// redactURI strips userinfo (username:password@) from a broker URI before
+// it is logged.
+func redactURI(uri string) string {
+	at := strings.LastIndex(uri, "@")
+	scheme := strings.Index(uri, "://")
+	if at == -1 || scheme == -1 || at < scheme {
+		return uri
+	}
+	return uri[:scheme+3] + "***" + uri[at:]
+}
@@ -0,0 +1,91 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// QueueStats is the subset of the management API's
+// /api/queues/{vhost}/{name} response the rate-based scaling modes need.
+type QueueStats struct {
+	Messages               int64
+	MessagesReady          int64
+	MessagesUnacknowledged int64
+	// PublishRate is messages/sec published into the queue, smoothed by RabbitMQ's own stats sampler.
+	PublishRate float64
+	// DeliverGetRate is messages/sec the consumers are draining the queue at.
+	DeliverGetRate float64
+}
+
+type queueStatsResponse struct {
+	Messages               int64 `json:"messages"`
+	MessagesReady          int64 `json:"messages_ready"`
+	MessagesUnacknowledged int64 `json:"messages_unacknowledged"`
+	MessageStats           struct {
+		PublishDetails struct {
+			Rate float64 `json:"rate"`
+		} `json:"publish_details"`
+		DeliverGetDetails struct {
+			Rate float64 `json:"rate"`
+		} `json:"deliver_get_details"`
+	} `json:"message_stats"`
+}
+
+// ManagementClient talks to the RabbitMQ HTTP management API.
+type ManagementClient struct {
+	baseURL  string
+	username string
+	password string
+	http     *http.Client
+}
+
+// NewManagementClient builds a client against the management API at baseURL
+// (e.g. "https://rabbitmq.example.com:15671").
+func NewManagementClient(baseURL, username, password string) *ManagementClient {
+	return &ManagementClient{
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+		http:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// QueueStats fetches the current stats for the queue named name in vhost.
+func (c *ManagementClient) QueueStats(vhost, name string) (QueueStats, error) {
+	if vhost == "" {
+		vhost = "/"
+	}
+
+	endpoint := fmt.Sprintf("%s/api/queues/%s/%s", c.baseURL, url.PathEscape(vhost), url.PathEscape(name))
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return QueueStats{}, fmt.Errorf("building request: %w", err)
+	}
+	req.SetBasicAuth(c.username, c.password)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return QueueStats{}, fmt.Errorf("requesting %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return QueueStats{}, fmt.Errorf("%s returned %s", endpoint, resp.Status)
+	}
+
+	var parsed queueStatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return QueueStats{}, fmt.Errorf("decoding response from %s: %w", endpoint, err)
+	}
+
+	return QueueStats{
+		Messages:               parsed.Messages,
+		MessagesReady:          parsed.MessagesReady,
+		MessagesUnacknowledged: parsed.MessagesUnacknowledged,
+		PublishRate:            parsed.MessageStats.PublishDetails.Rate,
+		DeliverGetRate:         parsed.MessageStats.DeliverGetDetails.Rate,
+	}, nil
+}
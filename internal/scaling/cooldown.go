@@ -0,0 +1,23 @@
+package scaling
+
+import "time"
+
+// CooldownElapsed reports whether enough time has passed since lastScaleTime
+// to permit a scale event in the given direction, mirroring HPA v2's
+// behavior.scaleUp/scaleDown.stabilizationWindowSeconds. A nil lastScaleTime
+// (no prior scale event) always permits scaling.
+func CooldownElapsed(lastScaleTime *time.Time, now time.Time, scalingUp bool, upWindowSeconds, downWindowSeconds int32) bool {
+	if lastScaleTime == nil {
+		return true
+	}
+
+	window := downWindowSeconds
+	if scalingUp {
+		window = upWindowSeconds
+	}
+	if window <= 0 {
+		return true
+	}
+
+	return now.Sub(*lastScaleTime) >= time.Duration(window)*time.Second
+}
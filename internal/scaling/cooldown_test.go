@@ -0,0 +1,68 @@
+package scaling
+
+import (
+	"testing"
+	"time"
+)
+
+func timePtr(t time.Time) *time.Time { return &t }
+
+func TestCooldownElapsed(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name                               string
+		lastScaleTime                      *time.Time
+		scalingUp                          bool
+		upWindowSeconds, downWindowSeconds int32
+		want                               bool
+	}{
+		{
+			name:          "nil lastScaleTime always permits scaling",
+			lastScaleTime: nil,
+			scalingUp:     true,
+			want:          true,
+		},
+		{
+			name:              "scale up still inside the up window is blocked",
+			lastScaleTime:     timePtr(now.Add(-10 * time.Second)),
+			scalingUp:         true,
+			upWindowSeconds:   30,
+			downWindowSeconds: 300,
+			want:              false,
+		},
+		{
+			name:              "scale up past the up window is permitted",
+			lastScaleTime:     timePtr(now.Add(-40 * time.Second)),
+			scalingUp:         true,
+			upWindowSeconds:   30,
+			downWindowSeconds: 300,
+			want:              true,
+		},
+		{
+			name:              "scale down at the same elapsed time uses the down window, not the up window",
+			lastScaleTime:     timePtr(now.Add(-40 * time.Second)),
+			scalingUp:         false,
+			upWindowSeconds:   30,
+			downWindowSeconds: 300,
+			want:              false,
+		},
+		{
+			name:              "a zero window for the requested direction always permits scaling",
+			lastScaleTime:     timePtr(now.Add(-time.Second)),
+			scalingUp:         true,
+			upWindowSeconds:   0,
+			downWindowSeconds: 300,
+			want:              true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CooldownElapsed(tt.lastScaleTime, now, tt.scalingUp, tt.upWindowSeconds, tt.downWindowSeconds)
+			if got != tt.want {
+				t.Errorf("CooldownElapsed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// Package scaling turns observed RabbitMQ backlog into a replica count.
+package scaling
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/basset/rabbitmq-pod-autoscaler/apis/v1alpha1"
+)
+
+// Aggregate combines per-queue message counts according to mode. counts must
+// contain one entry per spec.QueueTargets element, keyed by QueueTarget.Name.
+func Aggregate(mode v1alpha1.AggregationMode, targets []v1alpha1.QueueTarget, counts map[string]int64) (float64, error) {
+	values := make(map[string]float64, len(counts))
+	for name, count := range counts {
+		values[name] = float64(count)
+	}
+	return AggregateFloat(mode, targets, values)
+}
+
+// AggregateFloat is Aggregate's generalization over float-valued
+// observations (e.g. management API rates), used by the rate-based scaling
+// modes. values must contain one entry per spec.QueueTargets element, keyed
+// by QueueTarget.Name.
+func AggregateFloat(mode v1alpha1.AggregationMode, targets []v1alpha1.QueueTarget, values map[string]float64) (float64, error) {
+	if len(targets) == 0 {
+		return 0, fmt.Errorf("no queue targets")
+	}
+
+	var sum float64
+	var max float64
+	for _, t := range targets {
+		value, ok := values[t.Name]
+		if !ok {
+			return 0, fmt.Errorf("no observation for queue %q", t.Name)
+		}
+		weight := t.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		weighted := value * float64(weight)
+		sum += weighted
+		if weighted > max {
+			max = weighted
+		}
+	}
+
+	switch mode {
+	case v1alpha1.AggregationMax:
+		return max, nil
+	case v1alpha1.AggregationAvg:
+		return sum / float64(len(targets)), nil
+	case v1alpha1.AggregationSum, "":
+		return sum, nil
+	default:
+		return 0, fmt.Errorf("unknown aggregation mode %q", mode)
+	}
+}
+
+// AverageMsgPerPod returns the weighted average MsgPerPod across targets, used
+// to turn an aggregated backlog figure back into a replica count.
+func AverageMsgPerPod(targets []v1alpha1.QueueTarget) float64 {
+	var weightedSum float64
+	var weightTotal float64
+	for _, t := range targets {
+		weight := t.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		weightedSum += float64(t.MsgPerPod) * float64(weight)
+		weightTotal += float64(weight)
+	}
+	if weightTotal == 0 {
+		return 0
+	}
+	return weightedSum / weightTotal
+}
+
+// rateEpsilon is the floor applied to consume rates before dividing by them,
+// so a fully idle consumer doesn't produce an infinite time-to-drain.
+const rateEpsilon = 0.01
+
+// clampAndDamp clamps replicas to [minReplicas, maxReplicas], then holds
+// back part of the change: on a scale-down, the fraction of the reduction
+// given by scaleDownFactor (the original single-queue autoscaler's
+// SCALE_FACTOR behaviour); on a scale-up, the symmetric fraction of the
+// increase given by scaleUpFactor. Both are shared by every scaling mode,
+// and a factor of 0 (the zero value) means "no damping in that direction".
+func clampAndDamp(replicas, currentReplicas, minReplicas, maxReplicas int32, scaleDownFactor, scaleUpFactor float64) int32 {
+	if replicas < minReplicas {
+		replicas = minReplicas
+	}
+	if replicas > maxReplicas {
+		replicas = maxReplicas
+	}
+
+	if replicas < currentReplicas && scaleDownFactor > 0 {
+		held := int32(math.Floor(float64(currentReplicas-replicas) * scaleDownFactor))
+		replicas += held
+	} else if replicas > currentReplicas && scaleUpFactor > 0 {
+		held := int32(math.Floor(float64(replicas-currentReplicas) * scaleUpFactor))
+		replicas -= held
+	}
+
+	return replicas
+}
+
+// Desired computes the replica count for the given aggregated backlog under
+// ScalingModeCount: ceil(backlog / msgPerPod).
+func Desired(backlog, msgPerPod float64, currentReplicas, minReplicas, maxReplicas int32, scaleDownFactor, scaleUpFactor float64) int32 {
+	if msgPerPod <= 0 {
+		msgPerPod = 1
+	}
+
+	replicas := int32(math.Ceil(backlog / msgPerPod))
+	return clampAndDamp(replicas, currentReplicas, minReplicas, maxReplicas, scaleDownFactor, scaleUpFactor)
+}
+
+// DesiredRate computes the replica count under ScalingModeRate: msgPerPod is
+// read as the publish-rate throughput (messages/sec) a single pod can absorb,
+// and publishRate is the aggregated ingress rate across queue targets.
+func DesiredRate(publishRate, msgPerPod float64, currentReplicas, minReplicas, maxReplicas int32, scaleDownFactor, scaleUpFactor float64) int32 {
+	if msgPerPod <= 0 {
+		msgPerPod = rateEpsilon
+	}
+
+	replicas := int32(math.Ceil(publishRate / msgPerPod))
+	return clampAndDamp(replicas, currentReplicas, minReplicas, maxReplicas, scaleDownFactor, scaleUpFactor)
+}
+
+// DesiredDrainSLA computes the replica count under ScalingModeDrainSLA: the
+// smallest replica count that keeps estimated time-to-drain
+// (messages / consume rate) under slaSeconds, given the aggregated consume
+// rate observed at currentReplicas.
+func DesiredDrainSLA(backlog, consumeRate float64, currentReplicas, minReplicas, maxReplicas, slaSeconds int32, scaleDownFactor, scaleUpFactor float64) int32 {
+	if currentReplicas <= 0 {
+		currentReplicas = 1
+	}
+	perPodRate := consumeRate / float64(currentReplicas)
+	if perPodRate < rateEpsilon {
+		perPodRate = rateEpsilon
+	}
+	if slaSeconds <= 0 {
+		slaSeconds = 1
+	}
+
+	replicas := int32(math.Ceil(backlog / (perPodRate * float64(slaSeconds))))
+	return clampAndDamp(replicas, currentReplicas, minReplicas, maxReplicas, scaleDownFactor, scaleUpFactor)
+}
@@ -0,0 +1,117 @@
+package scaling
+
+import "testing"
+
+func TestClampAndDamp(t *testing.T) {
+	tests := []struct {
+		name                                                string
+		replicas, currentReplicas, minReplicas, maxReplicas int32
+		scaleDownFactor, scaleUpFactor                      float64
+		want                                                int32
+	}{
+		{
+			name:            "clamps below minReplicas",
+			replicas:        0,
+			currentReplicas: 2,
+			minReplicas:     1,
+			maxReplicas:     10,
+			want:            1,
+		},
+		{
+			name:            "clamps above maxReplicas",
+			replicas:        20,
+			currentReplicas: 2,
+			minReplicas:     1,
+			maxReplicas:     10,
+			want:            10,
+		},
+		{
+			name:            "scale-down holds back the floor of the withheld fraction",
+			replicas:        1,
+			currentReplicas: 10,
+			minReplicas:     1,
+			maxReplicas:     10,
+			scaleDownFactor: 0.5,
+			// reduction = 10-1 = 9; held back = floor(9*0.5) = 4; replicas = 1+4
+			want: 5,
+		},
+		{
+			name:            "a scale-down factor of 0 applies the full reduction",
+			replicas:        1,
+			currentReplicas: 10,
+			minReplicas:     1,
+			maxReplicas:     10,
+			scaleDownFactor: 0,
+			want:            1,
+		},
+		{
+			name:            "scale-up holds back the floor of the withheld fraction",
+			replicas:        10,
+			currentReplicas: 1,
+			minReplicas:     1,
+			maxReplicas:     10,
+			scaleUpFactor:   0.5,
+			// increase = 10-1 = 9; held back = floor(9*0.5) = 4; replicas = 10-4
+			want: 6,
+		},
+		{
+			name:            "a scale-up factor of 0 applies the full increase",
+			replicas:        10,
+			currentReplicas: 1,
+			minReplicas:     1,
+			maxReplicas:     10,
+			scaleUpFactor:   0,
+			want:            10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clampAndDamp(tt.replicas, tt.currentReplicas, tt.minReplicas, tt.maxReplicas, tt.scaleDownFactor, tt.scaleUpFactor)
+			if got != tt.want {
+				t.Errorf("clampAndDamp() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDesiredDrainSLA(t *testing.T) {
+	tests := []struct {
+		name                                                  string
+		backlog, consumeRate                                  float64
+		currentReplicas, minReplicas, maxReplicas, slaSeconds int32
+		want                                                  int32
+	}{
+		{
+			name:            "zero consume rate floors to the rate epsilon instead of dividing by zero",
+			backlog:         100,
+			consumeRate:     0,
+			currentReplicas: 2,
+			minReplicas:     1,
+			maxReplicas:     50,
+			slaSeconds:      30,
+			// perPodRate floors to rateEpsilon (0.01); ceil(100/(0.01*30)) = 334, clamped to maxReplicas
+			want: 50,
+		},
+		{
+			name:            "currentReplicas of 0 is treated as 1 pod rather than dividing by zero",
+			backlog:         30,
+			consumeRate:     3,
+			currentReplicas: 0,
+			minReplicas:     1,
+			maxReplicas:     50,
+			slaSeconds:      10,
+			// currentReplicas floors to 1; perPodRate = 3/1 = 3; ceil(30/(3*10)) = 1
+			want: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DesiredDrainSLA(tt.backlog, tt.consumeRate, tt.currentReplicas, tt.minReplicas, tt.maxReplicas, tt.slaSeconds, 0, 0)
+			if got != tt.want {
+				t.Errorf("DesiredDrainSLA() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package scaling
+
+import (
+	"sync"
+	"time"
+)
+
+// RateWindowSeconds is the default duration of history a RateWindow
+// retains, mirroring the sampling window HPA v2 uses for its own rate
+// metrics.
+const RateWindowSeconds = 60
+
+type rateSample struct {
+	at    time.Time
+	value float64
+}
+
+// RateWindow smooths a series of per-reconcile rate observations (publish or
+// consume rate for one queue) into a moving average over a trailing window.
+// ScalingModeRate and ScalingModeDrainSLA feed one instantaneous
+// management-API sample into a RateWindow per reconcile rather than acting
+// on that sample directly, so a single noisy tick can't flap the replica
+// count. It is safe for concurrent use since the controller reconciles
+// multiple RabbitMQAutoscalers in parallel.
+type RateWindow struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	samples []rateSample
+}
+
+// NewRateWindow returns a RateWindow retaining samples for window.
+func NewRateWindow(window time.Duration) *RateWindow {
+	return &RateWindow{window: window}
+}
+
+// Observe records value as having been seen at now, drops samples older
+// than the window, and returns the mean of what remains.
+func (w *RateWindow) Observe(now time.Time, value float64) float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.samples = append(w.samples, rateSample{at: now, value: value})
+
+	cutoff := now.Add(-w.window)
+	live := w.samples[:0]
+	for _, s := range w.samples {
+		if s.at.After(cutoff) {
+			live = append(live, s)
+		}
+	}
+	w.samples = live
+
+	var sum float64
+	for _, s := range w.samples {
+		sum += s.value
+	}
+	return sum / float64(len(w.samples))
+}
@@ -0,0 +1,35 @@
+package scaling
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateWindowObserve(t *testing.T) {
+	t.Run("a single sample is its own mean", func(t *testing.T) {
+		w := NewRateWindow(60 * time.Second)
+		if got := w.Observe(time.Unix(0, 0), 10); got != 10 {
+			t.Errorf("Observe() = %v, want 10", got)
+		}
+	})
+
+	t.Run("averages every sample still inside the window", func(t *testing.T) {
+		w := NewRateWindow(60 * time.Second)
+		base := time.Unix(0, 0)
+		w.Observe(base, 10)
+		if got := w.Observe(base.Add(30*time.Second), 20); got != 15 {
+			t.Errorf("Observe() = %v, want 15", got)
+		}
+	})
+
+	t.Run("evicts samples older than the window", func(t *testing.T) {
+		w := NewRateWindow(60 * time.Second)
+		base := time.Unix(0, 0)
+		w.Observe(base, 10)
+		// 61s later the first sample has fallen outside the 60s window and
+		// should have been evicted, leaving only this observation.
+		if got := w.Observe(base.Add(61*time.Second), 20); got != 20 {
+			t.Errorf("Observe() = %v, want 20 (stale sample should have been evicted)", got)
+		}
+	})
+}
@@ -0,0 +1,35 @@
+// Package server exposes the autoscaler's HTTP endpoints: Prometheus
+// metrics plus health/readiness probes for the controller's informer.
+package server
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/tools/cache"
+)
+
+// New builds the autoscaler's HTTP handler. informerSynced reports whether the
+// informer cache has synced; until it has, /readyz fails so the kubelet
+// won't send traffic (there is none to send, but this also gates the
+// leader-election Deployment's rollout health checks).
+func New(informerSynced cache.InformerSynced) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !informerSynced() {
+			http.Error(w, "informer cache not synced", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	return mux
+}
@@ -1,170 +1,264 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	"math"
+	"net/http"
 	"os"
-	"reflect"
+	"os/signal"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/streadway/amqp"
-	autoscalingv1 "k8s.io/api/autoscaling/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	cacheddiscovery "k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/scale"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/klog/v2"
+
+	"github.com/basset/rabbitmq-pod-autoscaler/apis/v1alpha1"
+	"github.com/basset/rabbitmq-pod-autoscaler/internal/controller"
+	"github.com/basset/rabbitmq-pod-autoscaler/internal/election"
+	"github.com/basset/rabbitmq-pod-autoscaler/internal/rabbitmq"
+	"github.com/basset/rabbitmq-pod-autoscaler/internal/server"
 )
 
-type Config struct {
-	RabbitMQHost string
-	QueueName    string
-	Namespace    string
-	Deployment   string
-	MaxPods      int
-	MinPods      int
-	MsgPerPod    int
-	ScanInterval int
-	ScaleFactor  float64
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
 }
 
-var configKeys = struct {
-	RabbitMQHost string
-	QueueName    string
-	Namespace    string
-	Deployment   string
-	MaxPods      string
-	MinPods      string
-	MsgPerPod    string
-	ScanInterval string
-	ScaleFactor  string
-}{
-	RabbitMQHost: "AMQP_HOST",
-	QueueName:    "AMQP_BUILD_QUEUE",
-	Namespace:    "NAMESPACE",
-	Deployment:   "DEPLOYMENT",
-	MaxPods:      "MAX_PODS",
-	MinPods:      "MIN_PODS",
-	MsgPerPod:    "MSG_PER_POD",
-	ScanInterval: "SCAN_INTERVAL",
-	ScaleFactor:  "SCALE_FACTOR",
+func envOrDefaultDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(value)
 }
 
-func main() {
-	config := Config{}
-	debug := os.Getenv("DEBUG") == "true"
-	rConfigKeys := reflect.ValueOf(configKeys)
-	typeOfConfigKeys := rConfigKeys.Type()
-	pConfig := reflect.ValueOf(&config)
-	configStruct := pConfig.Elem()
-
-	for i := 0; i < rConfigKeys.NumField(); i++ {
-		envName := rConfigKeys.Field(i).Interface()
-		fieldName := typeOfConfigKeys.Field(i).Name
-		configField := configStruct.FieldByName(fieldName)
-		if !configField.IsValid() {
-			panic(fmt.Errorf("[Config] Field %s is not valid", fieldName))
-		}
-		if !configField.CanSet() {
-			panic(fmt.Errorf("[Config] Field %s is cannot be set", fieldName))
-		}
-		value := os.Getenv(envName.(string))
-		if value == "" {
-			panic(fmt.Errorf("[Config] Envrionmental variable %s is not set", envName))
-		}
-		if configField.Kind() == reflect.Int {
-			number, err := strconv.ParseInt(value, 10, 64)
-			if err != nil {
-				panic(fmt.Errorf("[Config] Field %s is not a valid int", fieldName))
-			}
-			configField.SetInt(number)
+func envOrDefaultBool(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// loadTLSConfig builds a *tls.Config for amqps:// connections from the
+// RABBITMQ_TLS_* env vars. Returns nil if none are set, so plain amqp://
+// URIs keep working unmodified.
+func loadTLSConfig() (*tls.Config, error) {
+	caFile := os.Getenv("RABBITMQ_TLS_CA_FILE")
+	certFile := os.Getenv("RABBITMQ_TLS_CERT_FILE")
+	keyFile := os.Getenv("RABBITMQ_TLS_KEY_FILE")
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle %s: %w", caFile, err)
 		}
-		if configField.Kind() == reflect.String {
-			configField.SetString(value)
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", caFile)
 		}
-		if configField.Kind() == reflect.Float64 {
-			number, err := strconv.ParseFloat(value, 64)
-			if err != nil {
-				panic(fmt.Errorf("[Config] Field %s is not a valid float64", fieldName))
-			}
-			configField.SetFloat(number)
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client cert/key: %w", err)
 		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
 
+	return tlsConfig, nil
+}
+
+func main() {
+	klog.InitFlags(nil)
+
+	amqpHost := os.Getenv("AMQP_HOST")
+	if amqpHost == "" {
+		klog.Fatalf("[Config] Envrionmental variable AMQP_HOST is not set")
+	}
+	amqpURIs := strings.Split(amqpHost, ",")
+	for i := range amqpURIs {
+		amqpURIs[i] = strings.TrimSpace(amqpURIs[i])
+	}
+	resyncPeriod, err := time.ParseDuration(envOrDefault("RESYNC_PERIOD", "30s"))
+	if err != nil {
+		klog.Fatalf("[Config] RESYNC_PERIOD is not a valid duration: %s", err)
+	}
+	metricsAddr := envOrDefault("METRICS_ADDR", ":8080")
+
 	kubeConfig, err := rest.InClusterConfig()
 	if err != nil {
-		panic(fmt.Errorf("[Kube]: Error creating config: %s", err))
+		klog.Fatalf("[Kube]: Error creating config: %s", err)
 	}
 
-	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	dynamicClient, err := dynamic.NewForConfig(kubeConfig)
 	if err != nil {
-		panic(fmt.Errorf("[Kube]: Error creating client: %s", err))
+		klog.Fatalf("[Kube]: Error creating dynamic client: %s", err)
 	}
 
-	conn, err := amqp.Dial(config.RabbitMQHost)
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(kubeConfig)
 	if err != nil {
-		panic(fmt.Errorf("[RabbitMQ] Failed to connect: %s", err))
+		klog.Fatalf("[Kube]: Error creating discovery client: %s", err)
 	}
-	ch, err := conn.Channel()
+	restMapper := restmapper.NewDeferredDiscoveryRESTMapper(cacheddiscovery.NewMemCacheClient(discoveryClient))
+
+	scaleClient, err := scale.NewForConfig(kubeConfig, restMapper, dynamic.LegacyAPIPathResolverFunc, scale.NewDiscoveryScaleKindResolver(discoveryClient))
 	if err != nil {
-		panic(fmt.Errorf("[RabbitMQ] Failed to open a channel: %s", err))
+		klog.Fatalf("[Kube]: Error creating scale client: %s", err)
 	}
 
-	for {
-		queue, err := ch.QueueInspect(config.QueueName)
-		if err != nil {
-			ch.Close()
-			conn.Close()
-			panic(fmt.Errorf("[RabbitMQ]: Error inspecting queue: %s", err))
-		}
-		messageCount := queue.Messages
+	tlsConfig, err := loadTLSConfig()
+	if err != nil {
+		klog.Fatalf("[RabbitMQ] %s", err)
+	}
 
-		if debug {
-			println(fmt.Sprintf("[Debug] [RabbitMQ] Message Count: %d", messageCount))
-		}
+	var mgmt *rabbitmq.ManagementClient
+	if managementURL := os.Getenv("RABBITMQ_MANAGEMENT_URL"); managementURL != "" {
+		mgmt = rabbitmq.NewManagementClient(managementURL, os.Getenv("RABBITMQ_MANAGEMENT_USERNAME"), os.Getenv("RABBITMQ_MANAGEMENT_PASSWORD"))
+	}
 
-		client := clientset.AppsV1().Deployments(config.Namespace)
-		currentScale, err := client.GetScale(config.Deployment, metav1.GetOptions{})
-		if err != nil {
-			panic(fmt.Errorf("[Kube]: Error getting scale: %s", err))
+	rmqOpts := rabbitmq.Options{URIs: amqpURIs, TLSConfig: tlsConfig}
+	if envOrDefault("RABBITMQ_COUNT_SOURCE", "amqp") == "management" {
+		if mgmt == nil {
+			klog.Fatalf("[Config] RABBITMQ_COUNT_SOURCE=management requires RABBITMQ_MANAGEMENT_URL to be set")
 		}
+		rmqOpts.Management = mgmt
+	}
+	rmq, err := rabbitmq.New(rmqOpts)
+	if err != nil {
+		klog.Fatalf("[RabbitMQ] Failed to connect: %s", err)
+	}
+	defer rmq.Close()
 
-		currentReplicas := int(currentScale.Spec.Replicas)
-		replicas := int(math.Ceil(float64(messageCount) / float64(config.MsgPerPod)))
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, resyncPeriod)
+	informer := factory.ForResource(v1alpha1.GroupVersionResource).Informer()
 
-		if replicas < config.MinPods {
-			replicas = config.MinPods
-		}
-		if replicas > config.MaxPods {
-			replicas = config.MaxPods
-		}
+	ctrl := controller.New(informer, dynamicClient, scaleClient, restMapper, rmq, mgmt)
 
-		if debug {
-			println(fmt.Sprintf("[Debug] [Kube] Current replicas: %d", currentReplicas))
-			println(fmt.Sprintf("[Debug] [Kube] Desired replicas: %d", replicas))
-		}
-		if replicas < currentReplicas {
-			desiredReplicas := int(math.Floor(float64(currentReplicas-replicas) * config.ScaleFactor))
-			replicas = desiredReplicas + replicas
-			if debug {
-				println(fmt.Sprintf("[Debug] [Kube] Scale down %f replicas: %d", config.ScaleFactor, replicas))
-			}
+	stopCh := make(chan struct{})
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		close(stopCh)
+	}()
+
+	httpServer := &http.Server{Addr: metricsAddr, Handler: server.New(ctrl.HasSynced)}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			klog.Errorf("[Server] %s", err)
 		}
-		if replicas != currentReplicas {
-			scale := autoscalingv1.Scale{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      currentScale.Name,
-					Namespace: currentScale.Namespace,
-				},
-				Spec: autoscalingv1.ScaleSpec{
-					Replicas: int32(replicas),
-				},
-			}
-			_, err = client.UpdateScale(config.Deployment, &scale)
-			if err != nil {
-				panic(fmt.Errorf("[Kube] Error scaling: %s", err))
-			}
-			println(fmt.Sprintf("[Kube]: Scaled to %d replicas", replicas))
+	}()
+	go func() {
+		<-stopCh
+		httpServer.Close()
+	}()
+
+	// The informer factory runs unconditionally, win or lose the election, so
+	// a follower's cache is already warm and it can take over within the
+	// lease duration if it becomes leader.
+	factory.Start(stopCh)
+
+	electionCfg := election.Config{
+		LeaseName:      envOrDefault("LEASE_NAME", "rabbitmq-pod-autoscaler"),
+		LeaseNamespace: envOrDefault("LEASE_NAMESPACE", envOrDefault("NAMESPACE", "default")),
+	}
+	electionCfg.Enabled, err = envOrDefaultBool("LEADER_ELECTION_ENABLED", true)
+	if err != nil {
+		klog.Fatalf("[Config] LEADER_ELECTION_ENABLED is not a valid bool: %s", err)
+	}
+	electionCfg.LeaseDuration, err = envOrDefaultDuration("LEASE_DURATION", 15*time.Second)
+	if err != nil {
+		klog.Fatalf("[Config] LEASE_DURATION is not a valid duration: %s", err)
+	}
+	electionCfg.RenewDeadline, err = envOrDefaultDuration("RENEW_DEADLINE", 10*time.Second)
+	if err != nil {
+		klog.Fatalf("[Config] RENEW_DEADLINE is not a valid duration: %s", err)
+	}
+	electionCfg.RetryPeriod, err = envOrDefaultDuration("RETRY_PERIOD", 2*time.Second)
+	if err != nil {
+		klog.Fatalf("[Config] RETRY_PERIOD is not a valid duration: %s", err)
+	}
+
+	if !electionCfg.Enabled {
+		if err := ctrl.Run(2, stopCh); err != nil {
+			klog.Fatalf("[Controller] %s", err)
 		}
-		time.Sleep(time.Duration(config.ScanInterval) * time.Second)
+		return
 	}
+
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		klog.Fatalf("[Kube]: Error creating clientset: %s", err)
+	}
+	lock, identity, err := election.NewLock(clientset, electionCfg)
+	if err != nil {
+		klog.Fatalf("[Election] %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var shuttingDown atomic.Bool
+	go func() {
+		<-stopCh
+		shuttingDown.Store(true)
+		cancel()
+	}()
+
+	klog.Infof("[Election] %s entering leader election for lease %s/%s", identity, electionCfg.LeaseNamespace, electionCfg.LeaseName)
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: electionCfg.LeaseDuration,
+		RenewDeadline: electionCfg.RenewDeadline,
+		RetryPeriod:   electionCfg.RetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				klog.Infof("[Election] %s became leader", identity)
+				if err := ctrl.Run(2, ctx.Done()); err != nil {
+					// Force the election loop to give up the lease: a leader
+					// stuck with zero working workers must not keep renewing
+					// forever and blocking every other replica from taking over.
+					klog.Errorf("[Controller] %s", err)
+					cancel()
+				}
+			},
+			OnStoppedLeading: func() {
+				if shuttingDown.Load() {
+					klog.Infof("[Election] %s shutting down", identity)
+					return
+				}
+				// Exit rather than keep running as a demoted follower: a
+				// second in-process controller instance would race the new
+				// leader's UpdateScale calls. The kubelet restarts the
+				// container and it rejoins the election clean.
+				klog.Fatalf("[Election] %s lost leadership, exiting", identity)
+			},
+			OnNewLeader: func(newIdentity string) {
+				if newIdentity != identity {
+					klog.Infof("[Election] new leader elected: %s", newIdentity)
+				}
+			},
+		},
+	})
 }